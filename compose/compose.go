@@ -22,6 +22,7 @@ import (
 	"math"
 	"os"
 	"os/user"
+	"path/filepath"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/pflag"
@@ -32,19 +33,57 @@ import (
 
 type StringMap map[string]string
 
+// resolveHostPath expands $VAR/${VAR} references in a compose bind-mount
+// source against the generating host's environment. docker-compose does
+// this substitution itself at `up` time, but the k8s and systemd outputs
+// have no such shell, so they need a concrete absolute path baked in.
+func resolveHostPath(path string) string {
+	return os.Expand(path, func(key string) string {
+		if key == "GOPATH" {
+			if gopath := os.Getenv("GOPATH"); gopath != "" {
+				return gopath
+			}
+			return filepath.Join(os.Getenv("HOME"), "go")
+		}
+		return os.Getenv(key)
+	})
+}
+
+// BindOptions carries compose-spec's bind-mount options; we only ever set
+// SElinux, for the podman/rootless-Fedora relabel suffix (":z"/":Z").
+type BindOptions struct {
+	SElinux string `yaml:"selinux"`
+}
+
 type Volume struct {
 	Type     string
 	Source   string
 	Target   string
-	ReadOnly bool `yaml:"read_only"`
+	ReadOnly bool         `yaml:"read_only"`
+	Bind     *BindOptions `yaml:"bind,omitempty"`
+}
+
+// DependsOnEntry is compose v3's long form of depends_on, which lets a
+// service wait on more than just its dependency's container having started.
+type DependsOnEntry struct {
+	Condition string `yaml:"condition"`
+}
+
+// Healthcheck is marshalled as compose's healthcheck: block.
+type Healthcheck struct {
+	Test        []string `yaml:"test"`
+	Interval    string   `yaml:"interval,omitempty"`
+	Timeout     string   `yaml:"timeout,omitempty"`
+	Retries     int      `yaml:"retries,omitempty"`
+	StartPeriod string   `yaml:"start_period,omitempty"`
 }
 
 type Service struct {
 	name          string // not exported
 	Image         string
-	ContainerName string   `yaml:"container_name"`
-	WorkingDir    string   `yaml:"working_dir"`
-	DependsOn     []string `yaml:"depends_on,omitempty"`
+	ContainerName string                    `yaml:"container_name"`
+	WorkingDir    string                    `yaml:"working_dir"`
+	DependsOn     map[string]DependsOnEntry `yaml:"depends_on,omitempty"`
 	Labels        StringMap
 	Environment   []string
 	Ports         []string
@@ -52,12 +91,16 @@ type Service struct {
 	TempFS        []string `yaml:",omitempty"`
 	User          string   `yaml:",omitempty"`
 	Command       string
+	Healthcheck   *Healthcheck `yaml:",omitempty"`
+	UsernsMode    string       `yaml:"userns_mode,omitempty"`
+	Platform      string       `yaml:",omitempty"`
 }
 
 type ComposeConfig struct {
-	Version  string
+	Version  string `yaml:",omitempty"`
 	Services map[string]Service
 	Volumes  map[string]StringMap
+	XPodman  map[string]interface{} `yaml:"x-podman,omitempty"`
 }
 
 type Options struct {
@@ -75,6 +118,12 @@ type Options struct {
 	TestPortRange  bool
 	Verbosity      int
 	OutFile        string
+	Format         string
+	Runtime        string
+	PodmanPod      bool
+	Image          string
+	ImageTag       string
+	Platforms      string
 }
 
 var opts Options
@@ -92,18 +141,65 @@ func toExposedPort(i int) string {
 	return fmt.Sprintf("%d:%d", i, i)
 }
 
+// addDependsOn records that svc should wait for dep to report healthy,
+// using compose v3's long depends_on form.
+func addDependsOn(svc *Service, dep string) {
+	if svc.DependsOn == nil {
+		svc.DependsOn = make(map[string]DependsOnEntry)
+	}
+	svc.DependsOn[dep] = DependsOnEntry{Condition: "service_healthy"}
+}
+
+// applyPodmanRuntime rewrites a generated service in place so the same
+// compose file also works with podman-compose/podman play on a rootless
+// Fedora/RHEL host: the $GOPATH/bin and data-dir bind mounts get an SELinux
+// relabel suffix, --user additionally sets podman's userns_mode: keep-id
+// (the user: uid is kept), and the healthcheck's start_period, which older
+// podman-compose releases choke on, is dropped.
+func applyPodmanRuntime(svc Service) Service {
+	if opts.UserOwnership {
+		svc.UsernsMode = "keep-id"
+	}
+	for i, v := range svc.Volumes {
+		if v.Type != "bind" {
+			continue
+		}
+		switch v.Target {
+		case "/gobin":
+			// read-only binary shared by every container: relabel shared.
+			svc.Volumes[i].Bind = &BindOptions{SElinux: "z"}
+		case "/data", "/secret/hmac":
+			// each node owns an exclusive data dir/secret file: relabel private.
+			svc.Volumes[i].Bind = &BindOptions{SElinux: "Z"}
+		}
+	}
+	if svc.Healthcheck != nil {
+		// podman-compose releases before 1.0 fail to parse start_period.
+		svc.Healthcheck.StartPeriod = ""
+	}
+	return svc
+}
+
 func initService(basename string, idx, grpcPort int) Service {
 	var svc Service
 
 	svc.name = name(basename, idx)
-	svc.Image = "dgraph/dgraph:latest"
+	svc.Image = resolveImage(opts)
 	svc.ContainerName = svc.name
 	svc.WorkingDir = fmt.Sprintf("/data/%s", svc.name)
 	if idx > 1 {
-		svc.DependsOn = append(svc.DependsOn, name(basename, idx-1))
+		addDependsOn(&svc, name(basename, idx-1))
 	}
 	svc.Labels = map[string]string{"cluster": "test"}
 
+	// compose's platform: field is single-valued (it picks which arch to
+	// pull/run, not a set to build), so it's only emitted when exactly one
+	// platform was requested. With more than one, docker-bake.hcl (written
+	// by writeBuildxBake) is the only multi-arch artifact produced.
+	if platforms := parsePlatforms(opts.Platforms); len(platforms) == 1 {
+		svc.Platform = platforms[0]
+	}
+
 	svc.Ports = []string{
 		toExposedPort(grpcPort),
 		toExposedPort(grpcPort + 1000), // http port
@@ -159,6 +255,17 @@ func getOffset(idx int) int {
 	return idx
 }
 
+// podmanPodAddr returns the address a peer service should be dialed at.
+// Inside --podman_pod every container shares one network namespace, so
+// sibling service names have no DNS entry there; every peer is instead
+// reached over the shared loopback interface.
+func podmanPodAddr(svcName string) string {
+	if opts.PodmanPod {
+		return "localhost"
+	}
+	return svcName
+}
+
 func getZero(idx int) Service {
 	basename := "zero"
 	grpcPort := zeroBasePort + getOffset(idx)
@@ -169,15 +276,24 @@ func getZero(idx int) Service {
 		svc.TempFS = append(svc.TempFS, fmt.Sprintf("/data/%s/zw", svc.name))
 	}
 
+	svc.Healthcheck = &Healthcheck{
+		// dgraph/dgraph is Alpine-based and has no curl; busybox wget is what's there.
+		Test:        []string{"CMD", "wget", "-q", "-O-", fmt.Sprintf("http://localhost:%d/state", grpcPort+1000)},
+		Interval:    "5s",
+		Timeout:     "5s",
+		Retries:     5,
+		StartPeriod: "10s",
+	}
+
 	svc.Command += fmt.Sprintf(" zero -o %d --idx=%d", idx-1, idx)
-	svc.Command += fmt.Sprintf(" --my=%s:%d", svc.name, grpcPort)
+	svc.Command += fmt.Sprintf(" --my=%s:%d", podmanPodAddr(svc.name), grpcPort)
 	svc.Command += fmt.Sprintf(" --replicas=%d",
 		int(math.Ceil(float64(opts.NumAlphas)/float64(opts.NumGroups))))
 	svc.Command += fmt.Sprintf(" --logtostderr -v=%d", opts.Verbosity)
 	if idx == 1 {
 		svc.Command += fmt.Sprintf(" --bindall")
 	} else {
-		svc.Command += fmt.Sprintf(" --peer=%s:%d", name(basename, 1), zeroBasePort)
+		svc.Command += fmt.Sprintf(" --peer=%s:%d", podmanPodAddr(name(basename, 1)), zeroBasePort)
 	}
 
 	return svc
@@ -199,10 +315,20 @@ func getAlpha(idx int) Service {
 		svc.TempFS = append(svc.TempFS, fmt.Sprintf("/data/%s/w", svc.name))
 	}
 
+	addDependsOn(&svc, "zero1")
+	svc.Healthcheck = &Healthcheck{
+		// dgraph/dgraph is Alpine-based and has no curl; busybox wget is what's there.
+		Test:        []string{"CMD", "wget", "-q", "-O-", fmt.Sprintf("http://localhost:%d/health", grpcPort)},
+		Interval:    "5s",
+		Timeout:     "5s",
+		Retries:     5,
+		StartPeriod: "15s",
+	}
+
 	svc.Command += fmt.Sprintf(" alpha -o %d", baseOffset+idx-1)
-	svc.Command += fmt.Sprintf(" --my=%s:%d", svc.name, internalPort)
+	svc.Command += fmt.Sprintf(" --my=%s:%d", podmanPodAddr(svc.name), internalPort)
 	svc.Command += fmt.Sprintf(" --lru_mb=%d", opts.LruSizeMB)
-	svc.Command += fmt.Sprintf(" --zero=zero1:%d", zeroBasePort)
+	svc.Command += fmt.Sprintf(" --zero=%s:%d", podmanPodAddr("zero1"), zeroBasePort)
 	svc.Command += fmt.Sprintf(" --logtostderr -v=%d", opts.Verbosity)
 	svc.Command += " --whitelist=10.0.0.0/8,172.16.0.0/12,192.168.0.0/16"
 	if opts.EnterpriseMode {
@@ -283,6 +409,21 @@ func main() {
 		"glog verbosity level")
 	cmd.PersistentFlags().StringVarP(&opts.OutFile, "out", "O", "./docker-compose.yml",
 		"name of output file")
+	cmd.PersistentFlags().StringVar(&opts.Format, "format", "compose",
+		"output format: compose (docker-compose.yml), k8s (Kubernetes manifests) or systemd (unit files)")
+	cmd.PersistentFlags().StringVar(&opts.Runtime, "runtime", "docker",
+		"container runtime the output targets: docker or podman")
+	cmd.PersistentFlags().BoolVar(&opts.PodmanPod, "podman_pod", false,
+		"group all services under a single shared-network pod, addressing peers via "+
+			"localhost instead of service name (requires --runtime=podman)")
+	cmd.PersistentFlags().StringVar(&opts.Image, "image", "dgraph/dgraph",
+		"image repository to use for zero/alpha containers")
+	cmd.PersistentFlags().StringVar(&opts.ImageTag, "image_tag", "latest",
+		"image tag to use for zero/alpha containers")
+	cmd.PersistentFlags().StringVar(&opts.Platforms, "platforms", "",
+		"comma-separated target platforms, e.g. linux/amd64,linux/arm64; a single "+
+			"platform is set on each service's platform: field, while more than one "+
+			"instead generates a companion docker-bake.hcl to build/push the manifest list")
 
 	err := cmd.ParseFlags(os.Args)
 	if err != nil {
@@ -313,6 +454,27 @@ func main() {
 	if opts.UserOwnership && opts.DataDir == "" {
 		fatal(fmt.Errorf("--user option requires --data_dir=<path>"))
 	}
+	switch opts.Format {
+	case "compose", "k8s", "systemd":
+	default:
+		fatal(fmt.Errorf("--format must be one of: compose, k8s, systemd"))
+	}
+	if opts.Format == "systemd" && opts.OutFile == "./docker-compose.yml" {
+		opts.OutFile = "./systemd"
+	}
+	if opts.Runtime != "docker" && opts.Runtime != "podman" {
+		fatal(fmt.Errorf("--runtime must be one of: docker, podman"))
+	}
+	if opts.PodmanPod && opts.Runtime != "podman" {
+		fatal(fmt.Errorf("--podman_pod requires --runtime=podman"))
+	}
+	if opts.Runtime == "podman" && opts.Format != "compose" {
+		fatal(fmt.Errorf("--runtime=podman is not supported with --format=%s", opts.Format))
+	}
+	platforms := parsePlatforms(opts.Platforms)
+	if len(platforms) > 1 && opts.Format == "systemd" {
+		fatal(fmt.Errorf("--platforms with more than one entry is not supported with --format=systemd"))
+	}
 
 	services := make(map[string]Service)
 
@@ -326,22 +488,61 @@ func main() {
 		services[svc.name] = svc
 	}
 
+	if opts.Runtime == "podman" {
+		for n, svc := range services {
+			services[n] = applyPodmanRuntime(svc)
+		}
+	}
+
+	// No top-level "version" key: the long-form depends_on/condition syntax
+	// used below is only valid in the version-less Compose Spec (docker
+	// compose v2+); "version: 3.5" makes docker-compose v1 reject it outright.
 	cfg := ComposeConfig{
-		Version:  "3.5",
 		Services: services,
 		Volumes:  make(map[string]StringMap),
 	}
+	if opts.PodmanPod {
+		cfg.XPodman = map[string]interface{}{"in_pod": true}
+	}
 
 	if opts.DataVol {
 		cfg.Volumes["data"] = StringMap{}
 	}
 
+	if len(platforms) > 1 {
+		if err := writeBuildxBake(opts, platforms); err != nil {
+			fatal(fmt.Errorf("unable to write buildx bake file: %+v", err))
+		}
+	}
+
 	if opts.Jaeger {
 		services["jaeger"] = getJaeger()
 	}
 
-	yml, err := yaml.Marshal(cfg)
-	x.CheckfNoTrace(err)
+	if opts.Format == "systemd" {
+		if opts.Jaeger {
+			warning("--jaeger is not supported with --format=systemd; ignoring")
+		}
+		if err := writeSystemdUnits(services, opts.OutFile); err != nil {
+			fatal(err)
+		}
+		return
+	}
+
+	var yml []byte
+	switch opts.Format {
+	case "k8s":
+		if opts.Jaeger {
+			warning("--jaeger is not supported with --format=k8s; ignoring")
+		}
+		yml, err = renderK8s(services, opts)
+		if err != nil {
+			fatal(err)
+		}
+	default: // "compose"
+		yml, err = yaml.Marshal(cfg)
+		x.CheckfNoTrace(err)
+	}
 
 	var out io.Writer
 	if opts.OutFile == "-" {
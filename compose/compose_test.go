@@ -0,0 +1,63 @@
+/*
+ * Copyright 2019 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package main
+
+import "testing"
+
+func TestApplyPodmanRuntimeSElinuxLabels(t *testing.T) {
+	cases := []struct {
+		target string
+		want   string
+	}{
+		{"/gobin", "z"},
+		{"/data", "Z"},
+		{"/secret/hmac", "Z"},
+	}
+
+	for _, c := range cases {
+		svc := Service{Volumes: []Volume{{Type: "bind", Target: c.target}}}
+		got := applyPodmanRuntime(svc)
+		if got.Volumes[0].Bind == nil || got.Volumes[0].Bind.SElinux != c.want {
+			t.Errorf("target %q: expected SElinux %q, got %+v", c.target, c.want, got.Volumes[0].Bind)
+		}
+	}
+}
+
+func TestApplyPodmanRuntimeSkipsNonBindVolumes(t *testing.T) {
+	svc := Service{Volumes: []Volume{{Type: "volume", Target: "/data"}}}
+	got := applyPodmanRuntime(svc)
+	if got.Volumes[0].Bind != nil {
+		t.Errorf("expected a non-bind volume to be left alone, got %+v", got.Volumes[0].Bind)
+	}
+}
+
+func TestApplyPodmanRuntimeKeepIdUserns(t *testing.T) {
+	opts.UserOwnership = true
+	defer func() { opts.UserOwnership = false }()
+
+	got := applyPodmanRuntime(Service{})
+	if got.UsernsMode != "keep-id" {
+		t.Errorf("expected UsernsMode keep-id, got %q", got.UsernsMode)
+	}
+}
+
+func TestApplyPodmanRuntimeDropsStartPeriod(t *testing.T) {
+	svc := Service{Healthcheck: &Healthcheck{StartPeriod: "10s"}}
+	got := applyPodmanRuntime(svc)
+	if got.Healthcheck.StartPeriod != "" {
+		t.Errorf("expected StartPeriod to be cleared for podman-compose, got %q", got.Healthcheck.StartPeriod)
+	}
+}
@@ -0,0 +1,301 @@
+/*
+ * Copyright 2019 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"sigs.k8s.io/yaml"
+
+	"github.com/dgraph-io/dgraph/x"
+)
+
+const (
+	aclSecretName = "dgraph-acl-secret"
+	aclSecretKey  = "hmac"
+)
+
+// splitCommand turns a compose-style space-separated Command into the
+// executable and its arguments, the way a Kubernetes container spec wants it.
+func splitCommand(cmd string) (string, []string) {
+	fields := strings.Fields(cmd)
+	if len(fields) == 0 {
+		return "", nil
+	}
+	return fields[0], fields[1:]
+}
+
+func targetPort(portMapping string) (int, bool) {
+	parts := strings.SplitN(portMapping, ":", 2)
+	target := parts[0]
+	if len(parts) == 2 {
+		target = parts[1]
+	}
+	n, err := strconv.Atoi(target)
+	if err != nil {
+		return 0, false
+	}
+	return n, true
+}
+
+func toContainerPorts(ports []string) []corev1.ContainerPort {
+	var out []corev1.ContainerPort
+	for _, p := range ports {
+		if n, ok := targetPort(p); ok {
+			out = append(out, corev1.ContainerPort{ContainerPort: int32(n)})
+		}
+	}
+	return out
+}
+
+func toServicePorts(ports []string) []corev1.ServicePort {
+	var out []corev1.ServicePort
+	for _, p := range ports {
+		if n, ok := targetPort(p); ok {
+			out = append(out, corev1.ServicePort{
+				Name:       fmt.Sprintf("p%d", n),
+				Port:       int32(n),
+				TargetPort: intstr.FromInt(n),
+			})
+		}
+	}
+	return out
+}
+
+func toEnvVars(env []string) []corev1.EnvVar {
+	var out []corev1.EnvVar
+	for _, e := range env {
+		kv := strings.SplitN(e, "=", 2)
+		ev := corev1.EnvVar{Name: kv[0]}
+		if len(kv) == 2 {
+			ev.Value = kv[1]
+		}
+		out = append(out, ev)
+	}
+	return out
+}
+
+// toK8sVolumes splits a compose Service's Volumes into the pod volumes/mounts
+// Kubernetes needs, plus any PersistentVolumeClaim the StatefulSet should
+// template (the k8s equivalent of a compose "volume"-typed mount, i.e.
+// --data_vol). The ACL HMAC secret bind mount is special-cased onto the
+// Secret created for it, mounted with SubPath so it lands as the single
+// file dgraph's --acl_secret_file expects rather than a directory of keys.
+// Unlike docker-compose, Kubernetes never expands $VAR references in
+// hostPath.path and rejects non-absolute paths outright, so every bind
+// source is resolved first. svc.TempFS (--tmpfs) has no compose Volume
+// entry of its own, so it's appended separately as memory-backed emptyDirs.
+func toK8sVolumes(svc Service, opts Options) ([]corev1.Volume, []corev1.VolumeMount, []corev1.PersistentVolumeClaim, error) {
+	var vols []corev1.Volume
+	var mounts []corev1.VolumeMount
+	var claims []corev1.PersistentVolumeClaim
+
+	for i, v := range svc.Volumes {
+		volName := fmt.Sprintf("%s-vol-%d", svc.name, i)
+		mount := corev1.VolumeMount{
+			Name:      volName,
+			MountPath: v.Target,
+			ReadOnly:  v.ReadOnly,
+		}
+
+		switch {
+		case opts.AclSecret != "" && v.Source == opts.AclSecret:
+			// v.Target is the file dgraph's --acl_secret_file expects
+			// (e.g. /secret/hmac); without SubPath the Secret volume
+			// mounts a directory of keys onto it instead.
+			mount.SubPath = aclSecretKey
+			mounts = append(mounts, mount)
+			vols = append(vols, corev1.Volume{
+				Name: volName,
+				VolumeSource: corev1.VolumeSource{
+					Secret: &corev1.SecretVolumeSource{
+						SecretName: aclSecretName,
+					},
+				},
+			})
+		case v.Type == "volume":
+			mounts = append(mounts, mount)
+			claims = append(claims, corev1.PersistentVolumeClaim{
+				ObjectMeta: metav1.ObjectMeta{Name: volName},
+				Spec: corev1.PersistentVolumeClaimSpec{
+					AccessModes: []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce},
+					Resources: corev1.ResourceRequirements{
+						Requests: corev1.ResourceList{
+							corev1.ResourceStorage: resource.MustParse("10Gi"),
+						},
+					},
+				},
+			})
+		default: // "bind"
+			mounts = append(mounts, mount)
+			hostPath := resolveHostPath(v.Source)
+			if !filepath.IsAbs(hostPath) {
+				return nil, nil, nil, x.Errorf(
+					"volume source %q (resolved to %q) is not an absolute path; "+
+						"hostPath.path requires one for --format=k8s", v.Source, hostPath)
+			}
+			vols = append(vols, corev1.Volume{
+				Name: volName,
+				VolumeSource: corev1.VolumeSource{
+					HostPath: &corev1.HostPathVolumeSource{Path: hostPath},
+				},
+			})
+		}
+	}
+
+	for i, p := range svc.TempFS {
+		volName := fmt.Sprintf("%s-tmpfs-%d", svc.name, i)
+		mounts = append(mounts, corev1.VolumeMount{Name: volName, MountPath: p})
+		vols = append(vols, corev1.Volume{
+			Name: volName,
+			VolumeSource: corev1.VolumeSource{
+				EmptyDir: &corev1.EmptyDirVolumeSource{Medium: corev1.StorageMediumMemory},
+			},
+		})
+	}
+
+	return vols, mounts, claims, nil
+}
+
+func k8sHeadlessService(svc Service) *corev1.Service {
+	return &corev1.Service{
+		TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "Service"},
+		ObjectMeta: metav1.ObjectMeta{Name: svc.name, Labels: svc.Labels},
+		Spec: corev1.ServiceSpec{
+			ClusterIP: corev1.ClusterIPNone,
+			Selector:  map[string]string{"app": svc.name},
+			Ports:     toServicePorts(svc.Ports),
+		},
+	}
+}
+
+func k8sStatefulSet(svc Service, opts Options) (*appsv1.StatefulSet, error) {
+	vols, mounts, claims, err := toK8sVolumes(svc, opts)
+	if err != nil {
+		return nil, err
+	}
+	command, args := splitCommand(svc.Command)
+	replicas := int32(1)
+
+	container := corev1.Container{
+		Name:         svc.name,
+		Image:        svc.Image,
+		Command:      []string{command},
+		Args:         args,
+		WorkingDir:   svc.WorkingDir,
+		Env:          toEnvVars(svc.Environment),
+		Ports:        toContainerPorts(svc.Ports),
+		VolumeMounts: mounts,
+	}
+	if svc.User != "" {
+		// --user is "${UID:-1000}", a docker-compose shell substitution;
+		// Kubernetes has no shell expansion for runAsUser, so extract the
+		// static uid the same way --format=systemd does.
+		uid, err := strconv.ParseInt(systemdUser(svc.User), 10, 64)
+		if err != nil {
+			return nil, x.Errorf("invalid --user uid %q: %v", svc.User, err)
+		}
+		container.SecurityContext = &corev1.SecurityContext{RunAsUser: &uid}
+	}
+
+	return &appsv1.StatefulSet{
+		TypeMeta:   metav1.TypeMeta{APIVersion: "apps/v1", Kind: "StatefulSet"},
+		ObjectMeta: metav1.ObjectMeta{Name: svc.name, Labels: svc.Labels},
+		Spec: appsv1.StatefulSetSpec{
+			ServiceName: svc.name,
+			Replicas:    &replicas,
+			Selector:    &metav1.LabelSelector{MatchLabels: map[string]string{"app": svc.name}},
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"app": svc.name}},
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{container},
+					Volumes:    vols,
+				},
+			},
+			VolumeClaimTemplates: claims,
+		},
+	}, nil
+}
+
+func k8sAclSecret(opts Options) (*corev1.Secret, error) {
+	data, err := os.ReadFile(opts.AclSecret)
+	if err != nil {
+		return nil, x.Errorf("unable to read acl secret file %q: %v", opts.AclSecret, err)
+	}
+	return &corev1.Secret{
+		TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "Secret"},
+		ObjectMeta: metav1.ObjectMeta{Name: aclSecretName},
+		Type:       corev1.SecretTypeOpaque,
+		Data:       map[string][]byte{aclSecretKey: data},
+	}, nil
+}
+
+// renderK8s converts the same Options/getZero/getAlpha-derived Services used
+// for docker-compose into a multi-document Kubernetes YAML stream: a
+// StatefulSet and headless Service per node, plus a shared Secret when ACL
+// is enabled.
+func renderK8s(services map[string]Service, opts Options) ([]byte, error) {
+	names := make([]string, 0, len(services))
+	for n, svc := range services {
+		if svc.name == "" {
+			continue // e.g. jaeger, not yet supported with --format=k8s
+		}
+		names = append(names, n)
+	}
+	sort.Strings(names)
+
+	var objs []interface{}
+	if opts.AclSecret != "" {
+		sec, err := k8sAclSecret(opts)
+		if err != nil {
+			return nil, err
+		}
+		objs = append(objs, sec)
+	}
+	for _, n := range names {
+		svc := services[n]
+		sts, err := k8sStatefulSet(svc, opts)
+		if err != nil {
+			return nil, err
+		}
+		objs = append(objs, k8sHeadlessService(svc))
+		objs = append(objs, sts)
+	}
+
+	var buf bytes.Buffer
+	for i, obj := range objs {
+		if i > 0 {
+			buf.WriteString("---\n")
+		}
+		b, err := yaml.Marshal(obj)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(b)
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,113 @@
+/*
+ * Copyright 2019 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package main
+
+import (
+	"testing"
+)
+
+func TestToK8sVolumesBindRequiresAbsolutePath(t *testing.T) {
+	svc := Service{
+		name: "alpha1",
+		Volumes: []Volume{
+			{Type: "bind", Source: "relative/path", Target: "/data"},
+		},
+	}
+	if _, _, _, err := toK8sVolumes(svc, Options{}); err == nil {
+		t.Fatal("expected an error for a non-absolute hostPath.path, got nil")
+	}
+}
+
+func TestToK8sVolumesAclSecretUsesSubPath(t *testing.T) {
+	opts := Options{AclSecret: "/etc/dgraph/hmac"}
+	svc := Service{
+		name: "alpha1",
+		Volumes: []Volume{
+			{Type: "bind", Source: opts.AclSecret, Target: "/secret/hmac", ReadOnly: true},
+		},
+	}
+
+	_, mounts, _, err := toK8sVolumes(svc, opts)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(mounts) != 1 {
+		t.Fatalf("expected 1 volume mount, got %d", len(mounts))
+	}
+	if mounts[0].SubPath != aclSecretKey {
+		t.Errorf("expected SubPath %q, got %q", aclSecretKey, mounts[0].SubPath)
+	}
+	if mounts[0].MountPath != "/secret/hmac" {
+		t.Errorf("expected MountPath /secret/hmac, got %q", mounts[0].MountPath)
+	}
+}
+
+func TestToK8sVolumesDataVolBecomesClaim(t *testing.T) {
+	svc := Service{
+		name: "alpha1",
+		Volumes: []Volume{
+			{Type: "volume", Source: "data", Target: "/data"},
+		},
+	}
+
+	vols, mounts, claims, err := toK8sVolumes(svc, Options{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(vols) != 0 {
+		t.Errorf("expected no hostPath/secret volumes for a \"volume\"-typed mount, got %d", len(vols))
+	}
+	if len(mounts) != 1 {
+		t.Errorf("expected 1 volume mount, got %d", len(mounts))
+	}
+	if len(claims) != 1 {
+		t.Fatalf("expected 1 PersistentVolumeClaim, got %d", len(claims))
+	}
+}
+
+func TestToK8sVolumesTempFSBecomesMemoryEmptyDir(t *testing.T) {
+	svc := Service{
+		name:   "alpha1",
+		TempFS: []string{"/data/alpha1/w"},
+	}
+
+	vols, mounts, _, err := toK8sVolumes(svc, Options{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(vols) != 1 || len(mounts) != 1 {
+		t.Fatalf("expected 1 volume and mount for --tmpfs, got %d/%d", len(vols), len(mounts))
+	}
+	if mounts[0].MountPath != "/data/alpha1/w" {
+		t.Errorf("expected MountPath /data/alpha1/w, got %q", mounts[0].MountPath)
+	}
+	if vols[0].EmptyDir == nil || vols[0].EmptyDir.Medium != "Memory" {
+		t.Errorf("expected a memory-backed emptyDir, got %+v", vols[0].EmptyDir)
+	}
+}
+
+func TestK8sStatefulSetRunAsUser(t *testing.T) {
+	svc := Service{name: "alpha1", User: "${UID:-1000}"}
+
+	sts, err := k8sStatefulSet(svc, Options{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	sc := sts.Spec.Template.Spec.Containers[0].SecurityContext
+	if sc == nil || sc.RunAsUser == nil || *sc.RunAsUser != 1000 {
+		t.Errorf("expected RunAsUser 1000, got %+v", sc)
+	}
+}
@@ -0,0 +1,80 @@
+/*
+ * Copyright 2019 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+func parsePlatforms(raw string) []string {
+	if raw == "" {
+		return nil
+	}
+	var out []string
+	for _, p := range strings.Split(raw, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+func resolveImage(opts Options) string {
+	return fmt.Sprintf("%s:%s", opts.Image, opts.ImageTag)
+}
+
+// renderBuildxBake emits a `docker buildx bake` HCL target covering every
+// requested platform, so a single `docker buildx bake --push` builds and
+// pushes the manifest list the generated compose/k8s output references.
+func renderBuildxBake(opts Options, platforms []string) string {
+	quoted := make([]string, len(platforms))
+	for i, p := range platforms {
+		quoted[i] = fmt.Sprintf("%q", p)
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "group \"default\" {\n")
+	fmt.Fprintf(&buf, "  targets = [\"dgraph\"]\n")
+	fmt.Fprintf(&buf, "}\n\n")
+	fmt.Fprintf(&buf, "target \"dgraph\" {\n")
+	fmt.Fprintf(&buf, "  context   = \".\"\n")
+	fmt.Fprintf(&buf, "  tags      = [%q]\n", resolveImage(opts))
+	fmt.Fprintf(&buf, "  platforms = [%s]\n", strings.Join(quoted, ", "))
+	fmt.Fprintf(&buf, "}\n")
+	return buf.String()
+}
+
+// writeBuildxBake writes the bake file alongside the primary output, one
+// level up from per-format specifics, so the same `compose` invocation that
+// produced docker-compose.yml/k8s manifests also leaves behind the recipe to
+// build and push the manifest list those files reference.
+func writeBuildxBake(opts Options, platforms []string) error {
+	dir := "."
+	if opts.OutFile != "-" {
+		dir = filepath.Dir(opts.OutFile)
+	}
+	path := filepath.Join(dir, "docker-bake.hcl")
+
+	if err := os.WriteFile(path, []byte(renderBuildxBake(opts, platforms)), 0644); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "writing file: %s\n", path)
+	return nil
+}
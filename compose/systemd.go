@@ -0,0 +1,216 @@
+/*
+ * Copyright 2019 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/dgraph-io/dgraph/x"
+)
+
+// systemdStopTimeoutSec gives Raft peers long enough to step down/hand off
+// leadership cleanly instead of being SIGKILLed mid-election.
+const systemdStopTimeoutSec = 300
+
+func systemdUnitName(svcName string) string {
+	return fmt.Sprintf("dgraph-%s.service", svcName)
+}
+
+// systemdUser extracts the static uid out of the "${UID:-1000}" shell
+// substitution compose uses for --user, since unit files have no shell.
+func systemdUser(composeUser string) string {
+	u := strings.TrimPrefix(composeUser, "${UID:-")
+	return strings.TrimSuffix(u, "}")
+}
+
+// systemdWorkingDir returns the WorkingDirectory= systemd should use.
+// --user points svc.WorkingDir at a container-only "/working/<name>" scratch
+// dir that initService then redirects out of with a "--cwd=/data/<name>"
+// flag (see initService), since the real /data/<name> may not be writable
+// by the unprivileged user until the container's userns remapping kicks in.
+// There's no container here, so "/working/<name>" has nothing backing it on
+// the bare host; resolve the real /data/<name> mount instead.
+func systemdWorkingDir(svc Service) string {
+	dir := svc.WorkingDir
+	if strings.HasPrefix(dir, "/working/") {
+		dir = fmt.Sprintf("/data/%s", svc.name)
+	}
+	return systemdResolveContainerPath(dir, svc.Volumes)
+}
+
+// systemdVolumeSource resolves a compose Volume's Source into the concrete
+// host path systemd needs: env-vars like $GOPATH are only ever expanded by
+// docker-compose, and a "volume"-typed mount (--data_vol) has no
+// docker-volume equivalent under systemd, so it's rooted under a fixed
+// state directory instead.
+func systemdVolumeSource(v Volume) string {
+	if v.Type == "volume" {
+		return filepath.Join("/var/lib/dgraph-compose", v.Source)
+	}
+	return resolveHostPath(v.Source)
+}
+
+// systemdBindPaths maps compose Volumes onto BindPaths=/BindReadOnlyPaths=
+// directives.
+func systemdBindPaths(vols []Volume) (rw []string, ro []string) {
+	for _, v := range vols {
+		spec := fmt.Sprintf("%s:%s", systemdVolumeSource(v), v.Target)
+		if v.ReadOnly {
+			ro = append(ro, spec)
+		} else {
+			rw = append(rw, spec)
+		}
+	}
+	return rw, ro
+}
+
+// systemdResolveContainerPath rewrites a path rooted at one of svc's mount
+// targets (e.g. "/data/zero1") onto the real host path backing that mount,
+// since there's no container remapping those paths under systemd.
+func systemdResolveContainerPath(path string, vols []Volume) string {
+	for _, v := range vols {
+		if path == v.Target || strings.HasPrefix(path, v.Target+"/") {
+			return systemdVolumeSource(v) + strings.TrimPrefix(path, v.Target)
+		}
+	}
+	return path
+}
+
+// systemdExecStart rewrites a compose Command's references to container
+// mount targets (e.g. "/gobin/dgraph") into the real host paths systemd
+// will run, since there's no container remapping binds those paths anymore.
+func systemdExecStart(svc Service) string {
+	cmd := svc.Command
+	for _, v := range svc.Volumes {
+		cmd = strings.ReplaceAll(cmd, v.Target, systemdVolumeSource(v))
+	}
+	return cmd
+}
+
+func renderSystemdUnit(svc Service) string {
+	command, args := splitCommand(systemdExecStart(svc))
+	execStart := command
+	if len(args) > 0 {
+		execStart += " " + strings.Join(args, " ")
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "[Unit]\n")
+	fmt.Fprintf(&buf, "Description=dgraph %s\n", svc.name)
+	fmt.Fprintf(&buf, "PartOf=dgraph-cluster.target\n")
+	deps := make([]string, 0, len(svc.DependsOn))
+	for dep := range svc.DependsOn {
+		deps = append(deps, dep)
+	}
+	sort.Strings(deps)
+	for _, dep := range deps {
+		fmt.Fprintf(&buf, "After=%s\n", systemdUnitName(dep))
+		fmt.Fprintf(&buf, "Wants=%s\n", systemdUnitName(dep))
+	}
+
+	fmt.Fprintf(&buf, "\n[Service]\n")
+	fmt.Fprintf(&buf, "Type=simple\n")
+	fmt.Fprintf(&buf, "WorkingDirectory=%s\n", systemdWorkingDir(svc))
+	if svc.User != "" {
+		fmt.Fprintf(&buf, "User=%s\n", systemdUser(svc.User))
+	}
+	for _, e := range svc.Environment {
+		fmt.Fprintf(&buf, "Environment=%s\n", e)
+	}
+	if rw, ro := systemdBindPaths(svc.Volumes); len(rw) > 0 || len(ro) > 0 {
+		if len(rw) > 0 {
+			fmt.Fprintf(&buf, "BindPaths=%s\n", strings.Join(rw, " "))
+		}
+		if len(ro) > 0 {
+			fmt.Fprintf(&buf, "BindReadOnlyPaths=%s\n", strings.Join(ro, " "))
+		}
+	}
+	fmt.Fprintf(&buf, "ExecStart=%s\n", execStart)
+	fmt.Fprintf(&buf, "Restart=on-failure\n")
+	fmt.Fprintf(&buf, "TimeoutStopSec=%d\n", systemdStopTimeoutSec)
+
+	fmt.Fprintf(&buf, "\n[Install]\n")
+	fmt.Fprintf(&buf, "WantedBy=dgraph-cluster.target\n")
+	return buf.String()
+}
+
+func renderSystemdTarget(units []string) string {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "[Unit]\n")
+	fmt.Fprintf(&buf, "Description=dgraph cluster\n")
+	fmt.Fprintf(&buf, "Wants=%s\n", strings.Join(units, " "))
+
+	fmt.Fprintf(&buf, "\n[Install]\n")
+	fmt.Fprintf(&buf, "WantedBy=multi-user.target\n")
+	return buf.String()
+}
+
+// writeSystemdUnits renders a dgraph-<name>.service unit per Service plus a
+// grouping dgraph-cluster.target, and either streams them to stdout
+// (outPath == "-") or writes them as separate files under outPath.
+func writeSystemdUnits(services map[string]Service, outPath string) error {
+	names := make([]string, 0, len(services))
+	for n, svc := range services {
+		if svc.name == "" {
+			continue // e.g. jaeger, not yet supported with --format=systemd
+		}
+		names = append(names, n)
+	}
+	sort.Strings(names)
+
+	units := make([]string, 0, len(names))
+	for _, n := range names {
+		units = append(units, systemdUnitName(services[n].name))
+	}
+
+	files := map[string]string{"dgraph-cluster.target": renderSystemdTarget(units)}
+	for _, n := range names {
+		svc := services[n]
+		files[systemdUnitName(svc.name)] = renderSystemdUnit(svc)
+	}
+
+	if outPath == "-" {
+		filenames := make([]string, 0, len(files))
+		for f := range files {
+			filenames = append(filenames, f)
+		}
+		sort.Strings(filenames)
+
+		var buf bytes.Buffer
+		for _, f := range filenames {
+			fmt.Fprintf(&buf, "# %s\n", f)
+			buf.WriteString(files[f])
+			buf.WriteString("\n")
+		}
+		_, err := os.Stdout.Write(buf.Bytes())
+		return err
+	}
+
+	if err := os.MkdirAll(outPath, 0755); err != nil {
+		return x.Errorf("unable to create output directory %q: %v", outPath, err)
+	}
+	for name, contents := range files {
+		if err := os.WriteFile(filepath.Join(outPath, name), []byte(contents), 0644); err != nil {
+			return x.Errorf("unable to write unit file %q: %v", name, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+/*
+ * Copyright 2019 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSystemdExecStartRewritesMountTargets(t *testing.T) {
+	svc := Service{
+		Command: "/gobin/dgraph alpha --postings /data/alpha1/p",
+		Volumes: []Volume{
+			{Type: "bind", Source: "$GOPATH/bin", Target: "/gobin"},
+			{Type: "bind", Source: "/srv/dgraph", Target: "/data"},
+		},
+	}
+
+	got := systemdExecStart(svc)
+	if strings.Contains(got, "/gobin") || strings.Contains(got, "/data") {
+		t.Fatalf("expected every mount target rewritten to its host path, got %q", got)
+	}
+	if !strings.Contains(got, "/srv/dgraph/alpha1/p") {
+		t.Errorf("expected /data rewritten to /srv/dgraph, got %q", got)
+	}
+}
+
+func TestSystemdExecStartSubstringReplacementIsUnguarded(t *testing.T) {
+	// systemdExecStart does a literal strings.ReplaceAll per mount target,
+	// not a path-boundary-aware rewrite, so a flag value that merely
+	// contains a target as a substring (e.g. "/data2", not the "/data"
+	// mount itself) gets mangled too. This is currently safe only because
+	// no dgraph flag value happens to collide this way; this test pins the
+	// existing behavior so a future mount target (or flag) that collides
+	// doesn't regress silently.
+	svc := Service{
+		Command: "/gobin/dgraph alpha --my=/data2:7080",
+		Volumes: []Volume{
+			{Type: "bind", Source: "$GOPATH/bin", Target: "/gobin"},
+			{Type: "bind", Source: "/srv/dgraph", Target: "/data"},
+		},
+	}
+
+	got := systemdExecStart(svc)
+	if !strings.Contains(got, "/srv/dgraph2:7080") {
+		t.Errorf("expected literal substring replacement to fire even outside a path boundary, got %q", got)
+	}
+}
+
+func TestSystemdResolveContainerPath(t *testing.T) {
+	vols := []Volume{
+		{Type: "bind", Source: "/srv/dgraph", Target: "/data"},
+	}
+
+	if got, want := systemdResolveContainerPath("/data/zero1", vols), "/srv/dgraph/zero1"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if got, want := systemdResolveContainerPath("/elsewhere", vols), "/elsewhere"; got != want {
+		t.Errorf("expected an unmatched path to pass through unchanged, got %q", got)
+	}
+}
+
+func TestSystemdWorkingDirResolvesUserScratchDir(t *testing.T) {
+	svc := Service{
+		name:       "zero1",
+		WorkingDir: "/working/zero1",
+		Volumes: []Volume{
+			{Type: "bind", Source: "/srv/dgraph", Target: "/data"},
+		},
+	}
+
+	if got, want := systemdWorkingDir(svc), "/srv/dgraph/zero1"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestSystemdUser(t *testing.T) {
+	if got, want := systemdUser("${UID:-1000}"), "1000"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}